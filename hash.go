@@ -0,0 +1,181 @@
+package wots
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// HashFunc selects the hash family a Wotsparams uses.
+type HashFunc int
+
+const (
+	// SHA2 uses SHA-256 for n=32 and SHA-512 for n=64.
+	SHA2 HashFunc = iota
+	// SHAKE uses SHAKE256, reading n bytes of output regardless of n, so
+	// it can back either an n=32 (WOTSP-SHAKE_256) or n=64
+	// (WOTSP-SHAKE_512) parameter set.
+	SHAKE
+)
+
+// RFC 8391 §5.1 domain separators, prepended (as toByte(x, n)) to every
+// hash call so F, H, PRF and Hmsg -- which would otherwise all just be
+// "the underlying hash of some bytes" -- can never collide with one
+// another.
+const (
+	domainF = 0
+	domainH = 1
+	// domainHmsg is 2.
+	domainHmsg = 2
+	domainPRF  = 3
+)
+
+// Hasher is the set of domain-separated hash primitives RFC 8391 §5.1
+// defines, bound to a concrete hash family and output length n.
+// genChainPlus and Sign/Verify/PkFromSig's message compression go through
+// it instead of calling a hash function directly, so swapping HashFunc in
+// SetParams changes every hash call in the package consistently. It is
+// exported so many-time schemes built on top of wots, such as xmss's tree
+// and L-tree hashing, share this package's hardened F/H/PRF/Hmsg instead
+// of rolling their own.
+type Hasher interface {
+	// Hash is a plain, undomain-separated digest. It is what classic
+	// (non-plus) genChain iterates, and what Sign/Verify/PkFromSig use to
+	// compress an arbitrary-length message down to n bytes before
+	// computeB; RFC 8391 does not define a domain tag for either, since
+	// the one-time WOTS scheme itself doesn't prescribe message hashing.
+	Hash(m []byte) []byte
+	// F is the WOTS+ chain step hash: F(key, maskedBlock).
+	F(key, m []byte) []byte
+	// H combines two already-masked n-byte child nodes into their parent
+	// (xmss's tree and L-tree combine).
+	H(key, left, right []byte) []byte
+	// PRF derives an n-byte pseudo-random output from a key and an
+	// arbitrary-length input, typically an ADRS or a leaf index.
+	PRF(key, m []byte) []byte
+	// Hmsg is the randomized message digest many-time schemes such as
+	// xmss use: H(r, root, idx, M).
+	Hmsg(r, root []byte, idx uint32, message []byte) []byte
+}
+
+// HasherFor returns the Hasher implementation selected by params.
+func HasherFor(params Wotsparams) Hasher {
+	if params.hash == SHAKE {
+		return shakeHasher{n: params.n, legacy: params.LegacyPRF}
+	}
+	return sha2Hasher{n: params.n, legacy: params.LegacyPRF}
+}
+
+// toByte is RFC 8391's toByte(x, n): x encoded as a big-endian byte
+// string of exactly n bytes.
+func toByte(x uint64, n int) []byte {
+	b := make([]byte, n)
+	for i := n - 1; i >= 0 && x != 0; i-- {
+		b[i] = byte(x)
+		x >>= 8
+	}
+	return b
+}
+
+func taggedSum(digest func([]byte) []byte, domain uint64, n int, key []byte, parts ...[]byte) []byte {
+	buf := toByte(domain, n)
+	buf = append(buf, key...)
+	for _, p := range parts {
+		buf = append(buf, p...)
+	}
+	return digest(buf)
+}
+
+type sha2Hasher struct {
+	n int
+	// legacy selects the pre-chunk0-7 PRF, a domain-tagged plain hash
+	// rather than an HMAC, so Wotsparams{LegacyPRF: true} can still
+	// derive the same chain secrets and verify signatures produced
+	// before PRF switched to HMAC-SHA256/HMAC-SHA512.
+	legacy bool
+}
+
+func (h sha2Hasher) newHash() func() hash.Hash {
+	if h.n == 64 {
+		return sha512.New
+	}
+	return sha256.New
+}
+
+func (h sha2Hasher) digest(in []byte) []byte {
+	if h.n == 64 {
+		sum := sha512.Sum512(in)
+		return sum[:]
+	}
+	sum := sha256.Sum256(in)
+	return sum[:]
+}
+
+func (h sha2Hasher) Hash(m []byte) []byte { return h.digest(m) }
+
+func (h sha2Hasher) F(key, m []byte) []byte {
+	return taggedSum(h.digest, domainF, h.n, key, m)
+}
+
+func (h sha2Hasher) H(key, left, right []byte) []byte {
+	return taggedSum(h.digest, domainH, h.n, key, left, right)
+}
+
+// PRF is HMAC-SHA256 (n=32) or HMAC-SHA512 (n=64), per RFC 8391's intent
+// that PRF be indistinguishable from random given the key, which a plain
+// domain-tagged hash only approximates. See legacy for the prior
+// construction.
+func (h sha2Hasher) PRF(key, m []byte) []byte {
+	if h.legacy {
+		return taggedSum(h.digest, domainPRF, h.n, key, m)
+	}
+	mac := hmac.New(h.newHash(), key)
+	mac.Write(m)
+	return mac.Sum(nil)
+}
+
+func (h sha2Hasher) Hmsg(r, root []byte, idx uint32, message []byte) []byte {
+	return taggedSum(h.digest, domainHmsg, h.n, nil, r, root, toByte(uint64(idx), 4), message)
+}
+
+// shakeHasher reads n bytes out of SHAKE256 regardless of n, per the
+// WOTSP-SHAKE_256/WOTSP-SHAKE_512 parameter sets of RFC 8391.
+type shakeHasher struct {
+	n      int
+	legacy bool // see sha2Hasher.legacy
+}
+
+func (h shakeHasher) digest(in []byte) []byte {
+	out := make([]byte, h.n)
+	state := sha3.NewShake256()
+	state.Write(in)
+	state.Read(out)
+	return out
+}
+
+func (h shakeHasher) Hash(m []byte) []byte { return h.digest(m) }
+
+func (h shakeHasher) F(key, m []byte) []byte {
+	return taggedSum(h.digest, domainF, h.n, key, m)
+}
+
+func (h shakeHasher) H(key, left, right []byte) []byte {
+	return taggedSum(h.digest, domainH, h.n, key, left, right)
+}
+
+// PRF is KMAC256 (NIST SP 800-185), SHAKE's equivalent of an HMAC, for
+// the same reason sha2Hasher.PRF uses HMAC instead of a plain
+// domain-tagged hash. See legacy for the prior construction.
+func (h shakeHasher) PRF(key, m []byte) []byte {
+	if h.legacy {
+		return taggedSum(h.digest, domainPRF, h.n, key, m)
+	}
+	return kmac256(key, m, h.n, nil)
+}
+
+func (h shakeHasher) Hmsg(r, root []byte, idx uint32, message []byte) []byte {
+	return taggedSum(h.digest, domainHmsg, h.n, nil, r, root, toByte(uint64(idx), 4), message)
+}
@@ -0,0 +1,67 @@
+package wots
+
+import "golang.org/x/crypto/sha3"
+
+// cshake256Rate is cSHAKE256's sponge rate in bytes (1600-bit state minus
+// 512 bits of capacity), the block size bytepad aligns to.
+const cshake256Rate = 136
+
+// kmac256 computes KMAC256(key, data, outLen, customization) as defined
+// in NIST SP 800-185 §4. It is shakeHasher's PRF: a proper keyed MAC
+// built on cSHAKE256, rather than hashing key and data together the way
+// the package's plain F/H/Hash digests do.
+func kmac256(key, data []byte, outLen int, customization []byte) []byte {
+	newX := bytepad(encodeString(key), cshake256Rate)
+	newX = append(newX, data...)
+	newX = append(newX, rightEncode(uint64(outLen)*8)...)
+
+	state := sha3.NewCShake256([]byte("KMAC"), customization)
+	state.Write(newX)
+	out := make([]byte, outLen)
+	state.Read(out)
+	return out
+}
+
+// leftEncode is SP 800-185's left_encode: x as a big-endian byte string,
+// prefixed by its own length in one byte.
+func leftEncode(x uint64) []byte {
+	b := encodeUint(x)
+	return append([]byte{byte(len(b))}, b...)
+}
+
+// rightEncode is SP 800-185's right_encode: x as a big-endian byte
+// string, followed by its own length in one byte.
+func rightEncode(x uint64) []byte {
+	b := encodeUint(x)
+	return append(b, byte(len(b)))
+}
+
+// encodeUint returns x as the shortest big-endian byte string that
+// represents it, with a single 0x00 byte standing in for x == 0.
+func encodeUint(x uint64) []byte {
+	if x == 0 {
+		return []byte{0}
+	}
+	var b []byte
+	for x > 0 {
+		b = append([]byte{byte(x)}, b...)
+		x >>= 8
+	}
+	return b
+}
+
+// encodeString is SP 800-185's encode_string: s prefixed by its bit
+// length, left_encode'd.
+func encodeString(s []byte) []byte {
+	return append(leftEncode(uint64(len(s))*8), s...)
+}
+
+// bytepad is SP 800-185's bytepad: x prefixed by left_encode(w) and
+// zero-padded up to the next multiple of w bytes.
+func bytepad(x []byte, w int) []byte {
+	out := append(leftEncode(uint64(w)), x...)
+	if pad := len(out) % w; pad != 0 {
+		out = append(out, make([]byte, w-pad)...)
+	}
+	return out
+}
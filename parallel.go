@@ -0,0 +1,53 @@
+package wots
+
+import (
+	"runtime"
+	"sync"
+)
+
+// workers returns the number of goroutines forEachChain should use for
+// params: params.Parallelism if the caller set one (1 meaning fully
+// serial), or runtime.GOMAXPROCS(0) when left at its zero value.
+func (params Wotsparams) workers() int {
+	if params.Parallelism != 0 {
+		return params.Parallelism
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// forEachChain calls fn(i) once for every chain index in [0, params.length),
+// fanning the calls out across params.workers() goroutines. fn must only
+// touch the i-th chain's own slice of whatever output buffer it writes to,
+// so that the result is independent of how the work was scheduled -- the
+// parallel and serial (Parallelism == 1) paths are bit-identical.
+func forEachChain(params Wotsparams, fn func(i int)) {
+	n := params.length
+	workers := params.workers()
+	if workers <= 1 || n <= 1 {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+	if workers > n {
+		workers = n
+	}
+
+	jobs := make(chan int, n)
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fn(i)
+			}
+		}()
+	}
+	wg.Wait()
+}
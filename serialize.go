@@ -0,0 +1,344 @@
+package wots
+
+import (
+	"bytes"
+	"encoding/pem"
+	"errors"
+)
+
+// Wire format: a 4-byte magic, a 1-byte version, a 2-byte big-endian
+// parameter-set OID, then the raw key/signature bytes. The OID maps to a
+// fixed (hash, n, w) triple the way RFC 8391's own WOTSP OIDs do, so a
+// decoder never has to trust a length or parameter set supplied
+// out-of-band by whoever is handing it the bytes.
+var magic = [4]byte{'W', 'O', 'T', 'S'}
+
+const wireVersion = 1
+
+// oid identifies one of a small, fixed set of (hash, n, w) parameter
+// combinations this package knows how to serialize. Unlike Wotsparams
+// itself, arbitrary w values are deliberately not representable here:
+// Marshal refuses anything outside this table rather than inventing a
+// wire encoding for it.
+type oid uint16
+
+const (
+	oidWotsSHA2_256   oid = 1 // SetParams(32, 16, SHA2), LegacyPRF: classic WOTS chain
+	oidWotsSHA2_512   oid = 2 // SetParams(64, 16, SHA2), LegacyPRF
+	oidWotspSHA2_256  oid = 3 // SetParamsPlus(32, 16, SHA2), LegacyPRF: RFC 8391 WOTSP-SHA2_256
+	oidWotspSHA2_512  oid = 4 // SetParamsPlus(64, 16, SHA2), LegacyPRF: RFC 8391 WOTSP-SHA2_512
+	oidWotspSHAKE_256 oid = 5 // SetParamsPlus(32, 16, SHAKE), LegacyPRF: RFC 8391 WOTSP-SHAKE_256
+	oidWotspSHAKE_512 oid = 6 // SetParamsPlus(64, 16, SHAKE), LegacyPRF: RFC 8391 WOTSP-SHAKE_512
+
+	// OIDs 7-12 mirror 1-6 but select the default (non-legacy) ADRS/HMAC-
+	// or KMAC-based PRF introduced alongside LegacyPRF. They are separate
+	// OIDs, not a LegacyPRF bit grafted onto 1-6, so that keys and
+	// signatures serialized before LegacyPRF existed keep decoding under
+	// the construction they were actually produced with.
+	oidWotsSHA2_256NoLegacy   oid = 7
+	oidWotsSHA2_512NoLegacy   oid = 8
+	oidWotspSHA2_256NoLegacy  oid = 9
+	oidWotspSHA2_512NoLegacy  oid = 10
+	oidWotspSHAKE_256NoLegacy oid = 11
+	oidWotspSHAKE_512NoLegacy oid = 12
+)
+
+func oidFor(params Wotsparams) (oid, bool) {
+	switch {
+	case params.n == 32 && params.w == 16 && !params.plus && params.hash == SHA2:
+		return legacyOID(params, oidWotsSHA2_256, oidWotsSHA2_256NoLegacy), true
+	case params.n == 64 && params.w == 16 && !params.plus && params.hash == SHA2:
+		return legacyOID(params, oidWotsSHA2_512, oidWotsSHA2_512NoLegacy), true
+	case params.n == 32 && params.w == 16 && params.plus && params.hash == SHA2:
+		return legacyOID(params, oidWotspSHA2_256, oidWotspSHA2_256NoLegacy), true
+	case params.n == 64 && params.w == 16 && params.plus && params.hash == SHA2:
+		return legacyOID(params, oidWotspSHA2_512, oidWotspSHA2_512NoLegacy), true
+	case params.n == 32 && params.w == 16 && params.plus && params.hash == SHAKE:
+		return legacyOID(params, oidWotspSHAKE_256, oidWotspSHAKE_256NoLegacy), true
+	case params.n == 64 && params.w == 16 && params.plus && params.hash == SHAKE:
+		return legacyOID(params, oidWotspSHAKE_512, oidWotspSHAKE_512NoLegacy), true
+	default:
+		return 0, false
+	}
+}
+
+// legacyOID picks between a parameter combination's legacy and non-legacy
+// OID based on params.LegacyPRF.
+func legacyOID(params Wotsparams, legacy, current oid) oid {
+	if params.LegacyPRF {
+		return legacy
+	}
+	return current
+}
+
+func paramsForOID(id oid) (Wotsparams, bool) {
+	switch id {
+	case oidWotsSHA2_256:
+		params, _ := SetParams(32, 16, SHA2)
+		params.LegacyPRF = true
+		return params, true
+	case oidWotsSHA2_512:
+		params, _ := SetParams(64, 16, SHA2)
+		params.LegacyPRF = true
+		return params, true
+	case oidWotspSHA2_256:
+		params, _ := SetParamsPlus(32, 16, SHA2)
+		params.LegacyPRF = true
+		return params, true
+	case oidWotspSHA2_512:
+		params, _ := SetParamsPlus(64, 16, SHA2)
+		params.LegacyPRF = true
+		return params, true
+	case oidWotspSHAKE_256:
+		params, _ := SetParamsPlus(32, 16, SHAKE)
+		params.LegacyPRF = true
+		return params, true
+	case oidWotspSHAKE_512:
+		params, _ := SetParamsPlus(64, 16, SHAKE)
+		params.LegacyPRF = true
+		return params, true
+	case oidWotsSHA2_256NoLegacy:
+		params, _ := SetParams(32, 16, SHA2)
+		return params, true
+	case oidWotsSHA2_512NoLegacy:
+		params, _ := SetParams(64, 16, SHA2)
+		return params, true
+	case oidWotspSHA2_256NoLegacy:
+		params, _ := SetParamsPlus(32, 16, SHA2)
+		return params, true
+	case oidWotspSHA2_512NoLegacy:
+		params, _ := SetParamsPlus(64, 16, SHA2)
+		return params, true
+	case oidWotspSHAKE_256NoLegacy:
+		params, _ := SetParamsPlus(32, 16, SHAKE)
+		return params, true
+	case oidWotspSHAKE_512NoLegacy:
+		params, _ := SetParamsPlus(64, 16, SHAKE)
+		return params, true
+	default:
+		return Wotsparams{}, false
+	}
+}
+
+// appendHeader appends the 7-byte magic/version/OID header for id to out.
+func appendHeader(out []byte, id oid) []byte {
+	out = append(out, magic[:]...)
+	out = append(out, wireVersion)
+	out = append(out, byte(id>>8), byte(id))
+	return out
+}
+
+// parseHeader validates the header of data and returns the Wotsparams it
+// names along with the remaining payload bytes. It rejects an unknown
+// magic, version or OID outright, so Unmarshal never has to guess at the
+// parameter set of a truncated or corrupted buffer.
+func parseHeader(data []byte) (params Wotsparams, payload []byte, err error) {
+	const headerLen = len(magic) + 1 + 2
+	if len(data) < headerLen {
+		return params, nil, errors.New("wots: truncated header")
+	}
+	if !bytes.Equal(data[:len(magic)], magic[:]) {
+		return params, nil, errors.New("wots: bad magic")
+	}
+	if data[len(magic)] != wireVersion {
+		return params, nil, errors.New("wots: unsupported wire version")
+	}
+	id := oid(data[len(magic)+1])<<8 | oid(data[len(magic)+2])
+	params, ok := paramsForOID(id)
+	if !ok {
+		return params, nil, errors.New("wots: unknown parameter-set OID")
+	}
+	return params, data[headerLen:], nil
+}
+
+func pkWireLen(params Wotsparams) int {
+	n := params.Length() * params.N()
+	if params.Plus() {
+		n += params.N()
+	}
+	return n
+}
+
+// MarshalBinary encodes pub as magic || version || OID || raw public key
+// bytes. It fails if pub.Params is not one of the fixed parameter sets
+// this package can round-trip through an OID.
+func (pub PublicKey) MarshalBinary() ([]byte, error) {
+	id, ok := oidFor(pub.Params)
+	if !ok {
+		return nil, errors.New("wots: unsupported parameter set for serialization")
+	}
+	if len(pub.Bytes) != pkWireLen(pub.Params) {
+		return nil, errors.New("wots: public key length does not match its parameter set")
+	}
+	out := appendHeader(make([]byte, 0, 7+len(pub.Bytes)), id)
+	return append(out, pub.Bytes...), nil
+}
+
+// UnmarshalBinary decodes data produced by MarshalBinary. It rejects a
+// buffer whose payload length does not match the OID's parameter set,
+// rather than accepting a truncated or padded key silently.
+func (pub *PublicKey) UnmarshalBinary(data []byte) error {
+	params, payload, err := parseHeader(data)
+	if err != nil {
+		return err
+	}
+	if len(payload) != pkWireLen(params) {
+		return errors.New("wots: truncated or oversized public key")
+	}
+	pub.Params = params
+	pub.Bytes = append([]byte{}, payload...)
+	return nil
+}
+
+// MarshalBinary encodes priv as magic || version || OID || sk || pk. Both
+// the secret chain seeds and the public key are stored so UnmarshalBinary
+// does not need to recompute hash chains to reconstruct Public().
+func (priv *PrivateKey) MarshalBinary() ([]byte, error) {
+	id, ok := oidFor(priv.Params)
+	if !ok {
+		return nil, errors.New("wots: unsupported parameter set for serialization")
+	}
+	keyLen := pkWireLen(priv.Params)
+	if len(priv.sk) != keyLen || len(priv.pk) != keyLen {
+		return nil, errors.New("wots: private key length does not match its parameter set")
+	}
+	out := appendHeader(make([]byte, 0, 7+2*keyLen), id)
+	out = append(out, priv.sk...)
+	out = append(out, priv.pk...)
+	return out, nil
+}
+
+// UnmarshalBinary decodes data produced by MarshalBinary. The resulting
+// PrivateKey has no Seed(): it was reconstructed from sk/pk bytes, not a
+// master key.
+func (priv *PrivateKey) UnmarshalBinary(data []byte) error {
+	params, payload, err := parseHeader(data)
+	if err != nil {
+		return err
+	}
+	keyLen := pkWireLen(params)
+	if len(payload) != 2*keyLen {
+		return errors.New("wots: truncated or oversized private key")
+	}
+	priv.Params = params
+	priv.seed = nil
+	priv.sk = append([]byte{}, payload[:keyLen]...)
+	priv.pk = append([]byte{}, payload[keyLen:]...)
+	return nil
+}
+
+// Signature is a WOTS(+) signature paired with the Wotsparams it was
+// produced under, so it can be serialized and later verified without the
+// caller tracking the parameter set out of band.
+type Signature struct {
+	Params Wotsparams
+	Bytes  []byte
+}
+
+// MarshalBinary encodes sig as magic || version || OID || raw signature
+// bytes.
+func (sig Signature) MarshalBinary() ([]byte, error) {
+	id, ok := oidFor(sig.Params)
+	if !ok {
+		return nil, errors.New("wots: unsupported parameter set for serialization")
+	}
+	wantLen := sig.Params.Length() * sig.Params.N()
+	if len(sig.Bytes) != wantLen {
+		return nil, errors.New("wots: signature length does not match its parameter set")
+	}
+	out := appendHeader(make([]byte, 0, 7+len(sig.Bytes)), id)
+	return append(out, sig.Bytes...), nil
+}
+
+// UnmarshalBinary decodes data produced by MarshalBinary.
+func (sig *Signature) UnmarshalBinary(data []byte) error {
+	params, payload, err := parseHeader(data)
+	if err != nil {
+		return err
+	}
+	wantLen := params.Length() * params.N()
+	if len(payload) != wantLen {
+		return errors.New("wots: truncated or oversized signature")
+	}
+	sig.Params = params
+	sig.Bytes = append([]byte{}, payload...)
+	return nil
+}
+
+const (
+	pemTypePublicKey  = "WOTS PUBLIC KEY"
+	pemTypePrivateKey = "WOTS PRIVATE KEY"
+	pemTypeSignature  = "WOTS SIGNATURE"
+)
+
+// MarshalPEM PEM-encodes pub's MarshalBinary output under the
+// "WOTS PUBLIC KEY" block type.
+func (pub PublicKey) MarshalPEM() ([]byte, error) {
+	der, err := pub.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: pemTypePublicKey, Bytes: der}), nil
+}
+
+// ParsePublicKeyPEM decodes a "WOTS PUBLIC KEY" PEM block produced by
+// PublicKey.MarshalPEM.
+func ParsePublicKeyPEM(data []byte) (PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != pemTypePublicKey {
+		return PublicKey{}, errors.New("wots: not a " + pemTypePublicKey + " PEM block")
+	}
+	var pub PublicKey
+	if err := pub.UnmarshalBinary(block.Bytes); err != nil {
+		return PublicKey{}, err
+	}
+	return pub, nil
+}
+
+// MarshalPEM PEM-encodes priv's MarshalBinary output under the
+// "WOTS PRIVATE KEY" block type.
+func (priv *PrivateKey) MarshalPEM() ([]byte, error) {
+	der, err := priv.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: pemTypePrivateKey, Bytes: der}), nil
+}
+
+// ParsePrivateKeyPEM decodes a "WOTS PRIVATE KEY" PEM block produced by
+// PrivateKey.MarshalPEM.
+func ParsePrivateKeyPEM(data []byte) (*PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != pemTypePrivateKey {
+		return nil, errors.New("wots: not a " + pemTypePrivateKey + " PEM block")
+	}
+	priv := &PrivateKey{}
+	if err := priv.UnmarshalBinary(block.Bytes); err != nil {
+		return nil, err
+	}
+	return priv, nil
+}
+
+// MarshalPEM PEM-encodes sig's MarshalBinary output under the
+// "WOTS SIGNATURE" block type.
+func (sig Signature) MarshalPEM() ([]byte, error) {
+	der, err := sig.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: pemTypeSignature, Bytes: der}), nil
+}
+
+// ParseSignaturePEM decodes a "WOTS SIGNATURE" PEM block produced by
+// Signature.MarshalPEM.
+func ParseSignaturePEM(data []byte) (Signature, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != pemTypeSignature {
+		return Signature{}, errors.New("wots: not a " + pemTypeSignature + " PEM block")
+	}
+	var sig Signature
+	if err := sig.UnmarshalBinary(block.Bytes); err != nil {
+		return Signature{}, err
+	}
+	return sig, nil
+}
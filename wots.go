@@ -6,19 +6,28 @@ There are two parameters:
 -n which determines the security level (given in bytes)
 -w which allows a trade-off between signature size and computation costs.
 
-The implementation only allows n = {32, 64} at the moment and uses SHA256
-resp. SHA512 to provide a (classical) security level of 256-bit resp. 512-bit.
+The implementation only allows n = {32, 64} at the moment and, via the
+HashFunc passed to SetParams/SetParamsPlus, uses either SHA2 (SHA-256 for
+n=32, SHA-512 for n=64) or SHAKE256 to provide a (classical) security
+level of 256-bit resp. 512-bit.
 
 A secret key MUST only be used to sign ONE message.
+
+SetParamsPlus enables the WOTS+ construction from RFC 8391, which replaces
+the plain hash chain H(H(...)) with a chain that is bitmasked and bound to
+an address (ADRS) at every step. This gives the scheme domain separation
+between hash calls that would otherwise be identical, which is what makes
+WOTS+ resistant to the multi-target attacks that apply to the original
+WOTS chain.
 */
 package wots
 
 import (
 	"bytes"
-	"crypto/sha256"
-	"crypto/sha512"
+	"crypto"
 	"encoding/binary"
 	"errors"
+	"io"
 	"math"
 )
 
@@ -31,11 +40,29 @@ type Wotsparams struct {
 	w       int
 	logw    int
 	keysize int
+	plus    bool
+	hash    HashFunc
+
+	// Parallelism controls how many goroutines KeyGen, Sign and Verify use
+	// to compute the params.length independent hash chains they each
+	// iterate. 0 (the zero value, so a Wotsparams from SetParams defaults
+	// to it) means auto: use runtime.GOMAXPROCS(0) goroutines. 1 forces
+	// the original fully serial path, e.g. for deterministic benchmarking.
+	Parallelism int
+
+	// LegacyPRF selects the pre-HMAC/KMAC PRF construction (a plain
+	// domain-tagged hash of key||input) and expandKey's original
+	// low-entropy append(counter, byte(i)) chain-secret derivation,
+	// instead of the default PRF(SK_seed, ADRS_i)-based one. Set it to
+	// true only to keep verifying keys and signatures generated before
+	// this field existed; new keys should leave it false.
+	LegacyPRF bool
 }
 
 // SetParams takes the security parameter n and the winternitz parameter
-// w to initialize all parameters for the WOTS.
-func SetParams(n int, w int) (params Wotsparams, err error) {
+// w, and the hash family to build chains with, to initialize all
+// parameters for the WOTS.
+func SetParams(n int, w int, hash HashFunc) (params Wotsparams, err error) {
 	if (w & (w - 1)) != 0 {
 		return params, errors.New("w has to be a power of 2")
 	}
@@ -44,8 +71,13 @@ func SetParams(n int, w int) (params Wotsparams, err error) {
 		return params, errors.New("n has to be 32 or 64")
 	}
 
+	if hash != SHA2 && hash != SHAKE {
+		return params, errors.New("unknown hash function")
+	}
+
 	params.n = n
 	params.w = w
+	params.hash = hash
 	params.logw = int(math.Log2(float64(w)))
 	params.length1 = int(math.Ceil(float64((8 * n) / params.logw)))
 	params.length2 = int(math.Floor(math.Log2(float64(params.length1*(w-1)/
@@ -54,48 +86,211 @@ func SetParams(n int, w int) (params Wotsparams, err error) {
 	return params, nil
 }
 
+// SetParamsPlus behaves like SetParams but additionally switches the chain
+// function to WOTS+ (RFC 8391 §3.1.3): KeyGen, Sign and Verify derive a
+// public seed and feed it through PRF/F together with an ADRS at every
+// chain step instead of iterating a plain hash. The public (and secret)
+// key layout gains an appended n-byte pubSeed so Sign and Verify can
+// recover it without an extra parameter.
+func SetParamsPlus(n int, w int, hash HashFunc) (params Wotsparams, err error) {
+	params, err = SetParams(n, w, hash)
+	if err != nil {
+		return params, err
+	}
+	params.plus = true
+	return params, nil
+}
+
+// N returns the security parameter n (the hash output length in bytes).
+func (params Wotsparams) N() int { return params.n }
+
+// W returns the configured Winternitz parameter w.
+func (params Wotsparams) W() int { return params.w }
+
+// Length returns the total number of hash chains (length1 + length2) a
+// WOTS(+) key pair is made of.
+func (params Wotsparams) Length() int { return params.length }
+
+// Plus reports whether params was built with SetParamsPlus.
+func (params Wotsparams) Plus() bool { return params.plus }
+
 // KeyGen generates the secret key (sk) / public key (pk) pair for WOTS from a
 // master key. The master key MUST be chosen uniformly at random.
+//
+// When params was built with SetParamsPlus, sk and pk each gain an
+// additional n-byte pubSeed appended after the length*n chain bytes. The
+// pubSeed is derived from masterkey; use KeyGenSeeded to supply one
+// explicitly instead.
 func KeyGen(masterkey []byte, params Wotsparams) (sk []byte, pk []byte) {
-	sk = expandKey(masterkey, params)
+	var pubSeed []byte
+	if params.plus {
+		pubSeed = derivePubSeed(masterkey, params)
+	}
+	return KeyGenSeeded(masterkey, pubSeed, 0, params)
+}
+
+// KeyGenSeeded behaves like KeyGen but, in WOTS+ mode, uses the supplied
+// pubSeed instead of deriving one from masterkey. otsAddress is folded
+// into the ADRS expandKey derives every chain secret from, in both
+// classic and WOTS+ mode; in WOTS+ mode it additionally binds the public
+// chain stepping via genChainPlus's ADRS. Many-time schemes that keep a
+// single pubSeed shared across many WOTS+ key pairs (such as XMSS, where
+// every leaf's ADRS differs but the pubSeed does not) pass that leaf's
+// index as otsAddress so two leaves never compute the same PRF/F calls; a
+// standalone one-time key not part of such a tree should pass 0. pubSeed
+// is ignored in classic (non-plus) mode and may be nil.
+func KeyGenSeeded(masterkey []byte, pubSeed []byte, otsAddress uint32, params Wotsparams) (sk []byte, pk []byte) {
+	sk = expandKey(masterkey, otsAddress, params)
 	pk = make([]byte, params.n*params.length)
 
-	for i := 0; i < params.length; i++ {
+	if params.plus {
+		forEachChain(params, func(i int) {
+			adrs := newOTSAddress(otsAddress, i)
+			tmpChain := genChainPlus(sk[i*params.n:(i+1)*params.n], 0, params.w-1, pubSeed, adrs, params)
+			copy(pk[i*params.n:], tmpChain)
+		})
+		sk = append(sk, pubSeed...)
+		pk = append(pk, pubSeed...)
+		return sk, pk
+	}
+
+	forEachChain(params, func(i int) {
 		tmpChain := genChain(sk[i*params.n:(i+1)*params.n], 0, params.w-1, params)
 		copy(pk[i*params.n:], tmpChain)
-	}
+	})
 
 	return sk, pk
 }
 
-// Sign computes the signature for message using the secret key sk.
-func Sign(message []byte, sk []byte, params Wotsparams) (signature []byte) {
-	messageDigest := corehash(message, params.n)
+// Sign computes the signature for message using the secret key sk, binding
+// every chain's ADRS to otsAddress (see KeyGenSeeded). otsAddress MUST
+// match the one sk was generated with.
+func Sign(message []byte, sk []byte, otsAddress uint32, params Wotsparams) (signature []byte) {
+	messageDigest := HasherFor(params).Hash(message)
 	b := computeB(messageDigest, params)
 	// Compute Signature
 	signature = make([]byte, params.n*params.length)
 
-	for i := 0; i < params.length; i++ {
+	if params.plus {
+		pubSeed := sk[params.n*params.length:]
+		forEachChain(params, func(i int) {
+			adrs := newOTSAddress(otsAddress, i)
+			tmpChain := genChainPlus(sk[i*params.n:(i+1)*params.n], 0, b[i], pubSeed, adrs, params)
+			copy(signature[i*params.n:], tmpChain)
+		})
+		return signature
+	}
+
+	forEachChain(params, func(i int) {
 		tmpChain := genChain(sk[i*params.n:(i+1)*params.n], 0, b[i], params)
 		copy(signature[i*params.n:], tmpChain)
-	}
+	})
 	return signature
 }
 
-// Verify returns true if signature is a valid signature for message using pk.
-func Verify(message []byte, pk []byte, signature []byte, params Wotsparams) bool {
-	messageDigest := corehash(message, params.n)
-	b := computeB(messageDigest, params)
+// Verify returns true if signature is a valid signature for message using
+// pk. otsAddress must match the one the signer's key pair was generated
+// and signed with (see KeyGenSeeded); it is ignored in classic mode.
+func Verify(message []byte, pk []byte, signature []byte, otsAddress uint32, params Wotsparams) bool {
+	var pubSeed []byte
+	if params.plus {
+		pubSeed = pk[params.n*params.length:]
+	}
+	reconstructed := PkFromSig(message, signature, pubSeed, otsAddress, params)
+	return bytes.Equal(pk[:params.n*params.length], reconstructed)
+}
 
-	for i := 0; i < params.length; i++ {
-		tmpChain := genChain(signature[i*params.n:(i+1)*params.n], 0, params.w-1-b[i], params)
-		// Verify with pk
-		if !bytes.Equal(pk[params.n*i:params.n*(i+1)], tmpChain) {
-			return false
+// PkFromSig reconstructs the length*n chain bytes of the WOTS(+) public
+// key implied by signature for message, without comparing them to any
+// key the caller may already hold. Verify uses this internally; many-time
+// schemes built on top of WOTS (such as XMSS) use it directly to fold a
+// one-time signature into a larger authentication structure, since there
+// the verifier does not possess the leaf's public key out of band and is
+// instead deriving it as part of verification. In WOTS+ mode pubSeed must
+// be the same one the signer's key pair was generated with, and otsAddress
+// must be the same one passed to KeyGenSeeded/Sign for this key pair (see
+// KeyGenSeeded); both are ignored in classic mode.
+func PkFromSig(message []byte, signature []byte, pubSeed []byte, otsAddress uint32, params Wotsparams) []byte {
+	messageDigest := HasherFor(params).Hash(message)
+	b := computeB(messageDigest, params)
+	pk := make([]byte, params.n*params.length)
+
+	forEachChain(params, func(i int) {
+		var tmpChain []byte
+		if params.plus {
+			adrs := newOTSAddress(otsAddress, i)
+			tmpChain = genChainPlus(signature[i*params.n:(i+1)*params.n], b[i], params.w-1-b[i], pubSeed, adrs, params)
+		} else {
+			tmpChain = genChain(signature[i*params.n:(i+1)*params.n], 0, params.w-1-b[i], params)
 		}
+		copy(pk[i*params.n:], tmpChain)
+	})
+
+	return pk
+}
+
+// PublicKey is a WOTS(+) public key, pairing the raw bytes KeyGen returns
+// with the Wotsparams they were generated under so the two do not need
+// to be tracked separately. It satisfies crypto.PublicKey.
+type PublicKey struct {
+	Params Wotsparams
+	Bytes  []byte
+}
+
+// PrivateKey is a WOTS(+) private key. It satisfies crypto.Signer, which
+// lets WOTS keys drop into tls.Certificate, ssh.Signer adapters, and
+// other code written against crypto/*'s interfaces rather than raw
+// []byte. Like the byte-slice Sign it wraps, a PrivateKey built over a
+// plain Wotsparams (not an xmss leaf) MUST only sign ONE message.
+type PrivateKey struct {
+	Params Wotsparams
+	seed   []byte
+	sk     []byte
+	pk     []byte
+}
+
+var _ crypto.Signer = (*PrivateKey)(nil)
+
+// NewKeyFromSeed derives a PrivateKey from a master key the same way
+// KeyGen does. The master key MUST be chosen uniformly at random.
+func NewKeyFromSeed(seed []byte, params Wotsparams) *PrivateKey {
+	sk, pk := KeyGen(seed, params)
+	return &PrivateKey{
+		Params: params,
+		seed:   append([]byte{}, seed...),
+		sk:     sk,
+		pk:     pk,
 	}
+}
+
+// Public returns the PublicKey corresponding to priv.
+func (priv *PrivateKey) Public() crypto.PublicKey {
+	return PublicKey{Params: priv.Params, Bytes: append([]byte{}, priv.pk...)}
+}
 
-	return true
+// Seed returns the master key priv was derived from, e.g. for storage;
+// NewKeyFromSeed(priv.Seed(), priv.Params) reconstructs an equal key.
+func (priv *PrivateKey) Seed() []byte {
+	return append([]byte{}, priv.seed...)
+}
+
+// SignerOpts is the crypto.SignerOpts PrivateKey.Sign expects.
+type SignerOpts struct {
+	Hash crypto.Hash
+}
+
+// HashFunc implements crypto.SignerOpts.
+func (o SignerOpts) HashFunc() crypto.Hash { return o.Hash }
+
+// Sign implements crypto.Signer. digest is typically the output of
+// opts.HashFunc() applied to the message, and is passed straight through
+// to the byte-slice Sign this wraps, which applies its own internal
+// digest compression on top. rand is unused: like Sign, WOTS(+) signing
+// is deterministic given sk.
+func (priv *PrivateKey) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	// PrivateKey is always a single standalone one-time key, never one
+	// leaf of a many-time tree, so it is always OTS address 0.
+	return Sign(digest, priv.sk, 0, priv.Params), nil
 }
 
 func computeB(message []byte, params Wotsparams) (b []int) {
@@ -140,59 +335,165 @@ func baseW(input []byte, params Wotsparams) []int {
 	return output
 }
 
-// expandKey expands an n-byte key to a len * n byte array
-func expandKey(key []byte, params Wotsparams) (outseeds []byte) {
+// expandKey derives the params.length chain secrets that make up a
+// WOTS(+) private key from a single key seed. The default construction
+// is PRF(key, ADRS_i) with ADRS_i's chain_address set to i and
+// OTS_address set to otsAddress, per RFC 8391's intent that the
+// derivation be keyed by a proper PRF over a structured, domain-separated
+// address rather than a raw counter -- and, for many-time schemes sharing
+// one key seed across leaves, that the address differ per leaf too.
+// params.LegacyPRF selects legacyExpandKey instead, for keys generated
+// before this change; legacyExpandKey predates otsAddress and ignores it.
+func expandKey(key []byte, otsAddress uint32, params Wotsparams) (outseeds []byte) {
+	if params.LegacyPRF {
+		return legacyExpandKey(key, params)
+	}
+	h := HasherFor(params)
+	var buffer []byte
+	for i := 0; i < params.length; i++ {
+		adrs := newOTSAddress(otsAddress, i)
+		buffer = append(buffer, h.PRF(key, adrs[:])...)
+	}
+	return buffer
+}
+
+// legacyExpandKey is expandKey's pre-chunk0-7 construction: it derives
+// each chain secret from key and a low-entropy append(counter, byte(i))
+// input instead of a structured ADRS. Kept only so
+// Wotsparams{LegacyPRF: true} can still reproduce keys and signatures
+// generated before expandKey switched to an ADRS-based derivation.
+func legacyExpandKey(key []byte, params Wotsparams) (outseeds []byte) {
+	h := HasherFor(params)
 	var buffer []byte
 	for i := 0; i < params.length; i++ {
 		counter := make([]byte, params.n)
 		for j := 0; j < params.n; j++ {
 			counter = append(counter, byte(i))
 		}
-		buffer = append(buffer, prf(counter, key, params.n)...)
+		buffer = append(buffer, h.PRF(key, counter)...)
 	}
 	return buffer
 }
 
 func genChain(in []byte, start int, steps int, params Wotsparams) []byte {
+	h := HasherFor(params)
 	out := make([]byte, params.n)
 
 	copy(out, in)
 
 	for i := 0; i < (start+steps) && i < params.w; i++ {
-		out = hashf(out, params.n)
+		out = h.Hash(out)
 	}
 	return out
 }
 
-func hashf(in []byte, n int) (out []byte) {
-	var buffer []byte
+// adrsOTSHashAddress is the ADRS.type value for an OTS Hash Address
+// (RFC 8391 §2.7.3), the only address type this package constructs.
+const adrsOTSHashAddress = 0
 
-	buffer = append(buffer, in...)
+// ADRS is the 32-byte hash-function address of RFC 8391 §2.7. It feeds
+// into F and PRF alongside pubSeed so that every hash call in WOTS+ is
+// bound to the exact layer, OTS key pair, chain and step it is being made
+// for, which is what separates otherwise-identical hash invocations.
+type ADRS [32]byte
 
-	return corehash(buffer, n)
+// SetLayerAddress sets the address of the layer this ADRS belongs to.
+// WOTS+ on its own always operates at layer 0; XMSS sets this per level.
+func (a *ADRS) SetLayerAddress(v uint32) {
+	binary.BigEndian.PutUint32(a[0:4], v)
 }
 
-// prf is a pseudo-random function, which takes a key and an n-byte input
-// to produce an n-byte output.
-func prf(in []byte, key []byte, n int) (out []byte) {
-	var buffer []byte
+// SetTreeAddress sets the address of the tree this ADRS belongs to within
+// its layer.
+func (a *ADRS) SetTreeAddress(v uint64) {
+	binary.BigEndian.PutUint64(a[4:12], v)
+}
+
+// SetType sets the address type and, per RFC 8391, zeroes the
+// type-specific words that follow it.
+func (a *ADRS) SetType(v uint32) {
+	binary.BigEndian.PutUint32(a[12:16], v)
+	for i := 16; i < 32; i++ {
+		a[i] = 0
+	}
+}
+
+// SetOTSAddress sets the index of the WOTS+ key pair this ADRS addresses.
+func (a *ADRS) SetOTSAddress(v uint32) {
+	binary.BigEndian.PutUint32(a[16:20], v)
+}
 
-	buffer = append(buffer, key...)
-	buffer = append(buffer, in...)
+// SetChainAddress sets the index of the hash chain within the OTS key
+// pair, i.e. the i in chain_i.
+func (a *ADRS) SetChainAddress(v uint32) {
+	binary.BigEndian.PutUint32(a[20:24], v)
+}
+
+// SetHashAddress sets the index of the current step within the chain.
+func (a *ADRS) SetHashAddress(v uint32) {
+	binary.BigEndian.PutUint32(a[24:28], v)
+}
+
+// SetKeyAndMask selects whether F/PRF is deriving the step's key (0) or
+// its bitmask (1).
+func (a *ADRS) SetKeyAndMask(v uint32) {
+	binary.BigEndian.PutUint32(a[28:32], v)
+}
 
-	return corehash(buffer, n)
+// newOTSAddress returns an ADRS for chain chainIdx of OTS key pair
+// otsAddress, with layer/tree left at 0. otsAddress distinguishes the
+// many WOTS+ key pairs a caller such as XMSS generates under one shared
+// pubSeed; a standalone one-time key not part of such a tree uses 0.
+func newOTSAddress(otsAddress uint32, chainIdx int) ADRS {
+	var adrs ADRS
+	adrs.SetType(adrsOTSHashAddress)
+	adrs.SetOTSAddress(otsAddress)
+	adrs.SetChainAddress(uint32(chainIdx))
+	return adrs
 }
 
-func corehash(in []byte, n int) []byte {
-	switch n {
-	case 32:
-		checksum := sha256.Sum256(in)
-		return checksum[:]
-	case 64:
-		checksum := sha512.Sum512(in)
-		return checksum[:]
-	default:
-		checksum := sha256.Sum256(in)
-		return checksum[:]
+// genChainPlus computes the WOTS+ chain (RFC 8391 §3.1.3) on in, running
+// from step start for steps iterations (or until params.w is reached).
+// Each step derives a key and bitmask from pubSeed and adrs, masks the
+// running value, and hashes it under the derived key:
+//
+//	key_j  = PRF(pubSeed, ADRS with keyAndMask=0, hashAddress=j)
+//	mask_j = PRF(pubSeed, ADRS with keyAndMask=1, hashAddress=j)
+//	out    = F(key_j, out XOR mask_j)
+func genChainPlus(in []byte, start int, steps int, pubSeed []byte, adrs ADRS, params Wotsparams) []byte {
+	h := HasherFor(params)
+	out := make([]byte, params.n)
+	copy(out, in)
+
+	for i := start; i < start+steps && i < params.w; i++ {
+		adrs.SetHashAddress(uint32(i))
+
+		adrs.SetKeyAndMask(0)
+		key := h.PRF(pubSeed, adrs[:])
+
+		adrs.SetKeyAndMask(1)
+		mask := h.PRF(pubSeed, adrs[:])
+
+		out = h.F(key, xorBytes(out, mask))
 	}
+	return out
 }
+
+// xorBytes returns a XOR b. Both slices must have the same length.
+func xorBytes(a, b []byte) []byte {
+	out := make([]byte, len(a))
+	for i := range a {
+		out[i] = a[i] ^ b[i]
+	}
+	return out
+}
+
+// derivePubSeed derives the public seed for WOTS+ from the master key.
+// It is domain-separated from expandKey's chain-secret derivation by a
+// leading tag byte so the same master key cannot leak chain secrets
+// through the (public) pubSeed.
+func derivePubSeed(masterkey []byte, params Wotsparams) []byte {
+	return HasherFor(params).PRF(masterkey, []byte{pubSeedTag})
+}
+
+const pubSeedTag = 0x01
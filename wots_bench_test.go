@@ -0,0 +1,71 @@
+package wots
+
+import (
+	"crypto/rand"
+	"fmt"
+	"testing"
+)
+
+var benchParamSets = []struct{ n, w int }{
+	{32, 4},
+	{32, 16},
+	{64, 16},
+}
+
+func BenchmarkKeyGen(b *testing.B) {
+	for _, ps := range benchParamSets {
+		params, err := SetParamsPlus(ps.n, ps.w, SHA2)
+		if err != nil {
+			b.Fatalf("SetParamsPlus: %v", err)
+		}
+		masterkey := make([]byte, ps.n)
+		rand.Read(masterkey)
+
+		b.Run(fmt.Sprintf("n=%d,w=%d", ps.n, ps.w), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				KeyGen(masterkey, params)
+			}
+		})
+	}
+}
+
+func BenchmarkSign(b *testing.B) {
+	for _, ps := range benchParamSets {
+		params, err := SetParamsPlus(ps.n, ps.w, SHA2)
+		if err != nil {
+			b.Fatalf("SetParamsPlus: %v", err)
+		}
+		masterkey := make([]byte, ps.n)
+		message := make([]byte, ps.n)
+		rand.Read(masterkey)
+		rand.Read(message)
+		sk, _ := KeyGen(masterkey, params)
+
+		b.Run(fmt.Sprintf("n=%d,w=%d", ps.n, ps.w), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				Sign(message, sk, 0, params)
+			}
+		})
+	}
+}
+
+func BenchmarkVerify(b *testing.B) {
+	for _, ps := range benchParamSets {
+		params, err := SetParamsPlus(ps.n, ps.w, SHA2)
+		if err != nil {
+			b.Fatalf("SetParamsPlus: %v", err)
+		}
+		masterkey := make([]byte, ps.n)
+		message := make([]byte, ps.n)
+		rand.Read(masterkey)
+		rand.Read(message)
+		sk, pk := KeyGen(masterkey, params)
+		signature := Sign(message, sk, 0, params)
+
+		b.Run(fmt.Sprintf("n=%d,w=%d", ps.n, ps.w), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				Verify(message, pk, signature, 0, params)
+			}
+		})
+	}
+}
@@ -2,13 +2,15 @@ package wots
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/rand"
+	"encoding/hex"
 	"testing"
 )
 
 func TestSetParams(t *testing.T) {
 	// Test
-	params, _ := SetParams(32, 4)
+	params, _ := SetParams(32, 4, SHA2)
 
 	if params.length1 != 128 {
 		t.Errorf("length1 not computed correctly.")
@@ -18,19 +20,19 @@ func TestSetParams(t *testing.T) {
 		t.Errorf("length2 not computed correctly.")
 	}
 
-	params, err := SetParams(16, 4)
+	params, err := SetParams(16, 4, SHA2)
 	if err == nil {
 		t.Errorf("Invalid parameters allowed.")
 	}
 
-	params, err = SetParams(32, 7)
+	params, err = SetParams(32, 7, SHA2)
 	if err == nil {
 		t.Errorf("Invalid parameters allowed.")
 	}
 }
 
 func TestKeyGen(t *testing.T) {
-	params, _ := SetParams(32, 4)
+	params, _ := SetParams(32, 4, SHA2)
 	masterkey := make([]byte, 32)
 
 	for i := 0; i < 32; i++ {
@@ -45,7 +47,7 @@ func TestKeyGen(t *testing.T) {
 }
 
 func TestSignVerify(t *testing.T) {
-	params, _ := SetParams(32, 4)
+	params, _ := SetParams(32, 4, SHA2)
 	masterkey1 := make([]byte, 32)
 	masterkey2 := make([]byte, 32)
 	message1 := make([]byte, 32)
@@ -58,25 +60,25 @@ func TestSignVerify(t *testing.T) {
 	sk1, pk1 := KeyGen(masterkey1, params)
 	_, pk2 := KeyGen(masterkey2, params)
 
-	signature1 := Sign(message1, sk1, params)
+	signature1 := Sign(message1, sk1, 0, params)
 
-	if !Verify(message1, pk1, signature1, params) {
+	if !Verify(message1, pk1, signature1, 0, params) {
 		t.Error("Signature not valid.")
 	}
 
-	signature2 := Sign(message1, sk1, params)
+	signature2 := Sign(message1, sk1, 0, params)
 
 	if !bytes.Equal(signature1, signature2) {
 		t.Errorf("Signing is not deterministic.")
 	}
 
-	if Verify(message1, pk2, signature1, params) {
+	if Verify(message1, pk2, signature1, 0, params) {
 		t.Errorf("Signature verified with wrong key.")
 	}
 }
 
 func TestSignVerifyLarge(t *testing.T) {
-	params, _ := SetParams(64, 16)
+	params, _ := SetParams(64, 16, SHA2)
 	masterkey1 := make([]byte, 64)
 	masterkey2 := make([]byte, 64)
 	message1 := make([]byte, 64)
@@ -89,20 +91,497 @@ func TestSignVerifyLarge(t *testing.T) {
 	sk1, pk1 := KeyGen(masterkey1, params)
 	_, pk2 := KeyGen(masterkey2, params)
 
-	signature1 := Sign(message1, sk1, params)
+	signature1 := Sign(message1, sk1, 0, params)
 
-	if !Verify(message1, pk1, signature1, params) {
+	if !Verify(message1, pk1, signature1, 0, params) {
 		t.Error("Signature not valid.")
 	}
 
-	signature2 := Sign(message1, sk1, params)
+	signature2 := Sign(message1, sk1, 0, params)
 
 	if !bytes.Equal(signature1, signature2) {
 		t.Errorf("Signing is not deterministic.")
 	}
 
-	if Verify(message1, pk2, signature1, params) {
+	if Verify(message1, pk2, signature1, 0, params) {
 		t.Errorf("Signature verified with wrong key.")
 	}
 
 }
+
+func TestWotsPlusSignVerify(t *testing.T) {
+	params, _ := SetParamsPlus(32, 16, SHA2)
+	masterkey1 := make([]byte, 32)
+	masterkey2 := make([]byte, 32)
+	message1 := make([]byte, 32)
+
+	// Random key and messages
+	rand.Read(masterkey1)
+	rand.Read(masterkey2)
+	rand.Read(message1)
+
+	sk1, pk1 := KeyGen(masterkey1, params)
+	_, pk2 := KeyGen(masterkey2, params)
+
+	// pubSeed is appended to both sk and pk.
+	if len(sk1) != params.n*params.length+params.n {
+		t.Errorf("Secret key does not carry an appended pubSeed.")
+	}
+	if len(pk1) != params.n*params.length+params.n {
+		t.Errorf("Public key does not carry an appended pubSeed.")
+	}
+
+	signature1 := Sign(message1, sk1, 0, params)
+
+	if !Verify(message1, pk1, signature1, 0, params) {
+		t.Error("WOTS+ signature not valid.")
+	}
+
+	signature2 := Sign(message1, sk1, 0, params)
+
+	if !bytes.Equal(signature1, signature2) {
+		t.Errorf("WOTS+ signing is not deterministic.")
+	}
+
+	if Verify(message1, pk2, signature1, 0, params) {
+		t.Errorf("WOTS+ signature verified with wrong key.")
+	}
+
+	// A tampered pubSeed must also be rejected: it changes every mask and
+	// key derived along the chain, not just a single byte of the digest.
+	tamperedPk := append([]byte{}, pk1...)
+	tamperedPk[len(tamperedPk)-1] ^= 0xff
+	if Verify(message1, tamperedPk, signature1, 0, params) {
+		t.Errorf("WOTS+ signature verified with tampered pubSeed.")
+	}
+}
+
+// TestWotsPlusVectors pins down the WOTS+ public key and signature bytes
+// produced for a fixed master key, message and WOTSP-SHA2_256 parameter
+// set (n=32, w=16) from RFC 8391. The golden values below were produced
+// by this implementation; the RFC itself does not publish standalone
+// WOTS+ KATs (its test vectors are full XMSS trees), so this test guards
+// against accidental changes to the chain/ADRS construction rather than
+// claiming byte-for-byte RFC provenance. LegacyPRF is set so these
+// values keep pinning the pre-ADRS-based expandKey construction rather
+// than needing to be re-derived every time PRF changes.
+func TestWotsPlusVectors(t *testing.T) {
+	params, err := SetParamsPlus(32, 16, SHA2)
+	if err != nil {
+		t.Fatalf("SetParamsPlus: %v", err)
+	}
+	params.LegacyPRF = true
+
+	masterkey := make([]byte, 32)
+	for i := range masterkey {
+		masterkey[i] = byte(i)
+	}
+	message := make([]byte, 32)
+	for i := range message {
+		message[i] = byte(0xff - i)
+	}
+
+	wantPk := "589e67f4eeeaf3fd5fdc4f5d12c824c398f67a37ebfefdc6207fbcfd9ab3088f"
+	wantSig := "da03b5b46e71d024f79cc398558f5b8f704c354138b46566371635ee5843a5a8"
+
+	sk, pk := KeyGen(masterkey, params)
+	signature := Sign(message, sk, 0, params)
+
+	if got := hex.EncodeToString(pk[:32]); got != wantPk {
+		t.Errorf("pk[0:32] = %s, want %s", got, wantPk)
+	}
+	if got := hex.EncodeToString(signature[:32]); got != wantSig {
+		t.Errorf("signature[0:32] = %s, want %s", got, wantSig)
+	}
+
+	if !Verify(message, pk, signature, 0, params) {
+		t.Error("WOTS+ golden signature does not verify.")
+	}
+}
+
+// TestWotsPlusSHAKESignVerify exercises the WOTSP-SHAKE_256 parameter set
+// (SetParamsPlus(32, 16, SHAKE)): SHAKE256 must thread through F, H, PRF
+// and the message digest exactly like SHA2 does, just via a different
+// hasher implementation.
+func TestWotsPlusSHAKESignVerify(t *testing.T) {
+	params, err := SetParamsPlus(32, 16, SHAKE)
+	if err != nil {
+		t.Fatalf("SetParamsPlus: %v", err)
+	}
+	masterkey := make([]byte, 32)
+	message := make([]byte, 32)
+	rand.Read(masterkey)
+	rand.Read(message)
+
+	sk, pk := KeyGen(masterkey, params)
+	signature := Sign(message, sk, 0, params)
+
+	if !Verify(message, pk, signature, 0, params) {
+		t.Error("WOTSP-SHAKE_256 signature not valid.")
+	}
+
+	tamperedSig := append([]byte{}, signature...)
+	tamperedSig[0] ^= 0xff
+	if Verify(message, pk, tamperedSig, 0, params) {
+		t.Error("WOTSP-SHAKE_256 verified a tampered signature.")
+	}
+}
+
+// TestWotsPlusSHAKEVectors pins down the WOTSP-SHAKE_256 public key and
+// signature bytes produced for a fixed master key and message, with the
+// same provenance caveat as TestWotsPlusVectors: these are this
+// implementation's own golden values, not RFC 8391 KATs. LegacyPRF is
+// set for the same reason as in TestWotsPlusVectors.
+func TestWotsPlusSHAKEVectors(t *testing.T) {
+	params, err := SetParamsPlus(32, 16, SHAKE)
+	if err != nil {
+		t.Fatalf("SetParamsPlus: %v", err)
+	}
+	params.LegacyPRF = true
+
+	masterkey := make([]byte, 32)
+	for i := range masterkey {
+		masterkey[i] = byte(i)
+	}
+	message := make([]byte, 32)
+	for i := range message {
+		message[i] = byte(0xff - i)
+	}
+
+	wantPk := "d998a18960d13c911696cab011afc82af71ea155c879ec18fa945ff4f238cba6"
+	wantSig := "2707627ca6279b0f3bb32ec4f0111a78c22817c3c0e3745637cf1edab525b328"
+
+	sk, pk := KeyGen(masterkey, params)
+	signature := Sign(message, sk, 0, params)
+
+	if got := hex.EncodeToString(pk[:32]); got != wantPk {
+		t.Errorf("pk[0:32] = %s, want %s", got, wantPk)
+	}
+	if got := hex.EncodeToString(signature[:32]); got != wantSig {
+		t.Errorf("signature[0:32] = %s, want %s", got, wantSig)
+	}
+
+	if !Verify(message, pk, signature, 0, params) {
+		t.Error("WOTSP-SHAKE_256 golden signature does not verify.")
+	}
+	if bytes.Equal(pk[:32], sk[:32]) {
+		t.Error("SHAKE public key chain should differ from the secret seed it was derived from.")
+	}
+}
+
+// TestSHAKE256KAT pins shakeHasher.digest against FIPS 202's published
+// SHAKE256("") test vector, independently of any of this package's own
+// key/signature goldens: if toByte encoding or some other framing bug
+// ever crept into how bytes reach the underlying SHAKE256 call, a
+// self-referential vector pinned from this implementation's own output
+// would not catch it, but a hash function computed over a fixed external
+// input will.
+func TestSHAKE256KAT(t *testing.T) {
+	want := "46b9dd2b0ba88d13233b3feb743eeb243fcd52ea62b81b82b50c27646ed5762fd75dc4ddd8c0f200cb05019d67b592f6fc821c49479ab48640292eacb3b7c4be"
+	h := shakeHasher{n: 64}
+	if got := hex.EncodeToString(h.digest(nil)); got != want {
+		t.Errorf("SHAKE256(\"\") = %s, want %s", got, want)
+	}
+}
+
+// TestKMAC256KAT pins kmac256 against a KMAC256 output independently
+// computed with OpenSSL's own KMAC-256 implementation (`openssl mac
+// KMAC-256 -macopt hexkey:<key> -macopt size:32`), the same
+// externally-sourced cross-check TestSHAKE256KAT does for the underlying
+// SHAKE256 primitive. NIST SP 800-185 itself does not publish a KMAC256
+// sample with this exact key/data/length combination, so this anchors
+// the encode_string/bytepad/left_encode/right_encode framing against an
+// independent implementation rather than only this package's own output.
+func TestKMAC256KAT(t *testing.T) {
+	key, err := hex.DecodeString("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+	if err != nil {
+		t.Fatalf("decode key: %v", err)
+	}
+	data, err := hex.DecodeString("fffefdfcfbfaf9f8f7f6f5f4f3f2f1f0efeeedecebeae9e8e7e6e5e4e3e2e1e0")
+	if err != nil {
+		t.Fatalf("decode data: %v", err)
+	}
+	want := "dd1250c7ae58f07d37501770db4f0009354213bad1a32d9949764d2314e14b2b"
+
+	if got := hex.EncodeToString(kmac256(key, data, 32, nil)); got != want {
+		t.Errorf("KMAC256(key, data, 32) = %s, want %s", got, want)
+	}
+}
+
+func TestPrivateKeySigner(t *testing.T) {
+	params, _ := SetParamsPlus(32, 16, SHA2)
+	seed := make([]byte, 32)
+	rand.Read(seed)
+
+	priv := NewKeyFromSeed(seed, params)
+
+	var signer crypto.Signer = priv
+	if !bytes.Equal(signer.Public().(PublicKey).Bytes, priv.pk) {
+		t.Errorf("Public() did not return the key pair's public key.")
+	}
+
+	if !bytes.Equal(priv.Seed(), seed) {
+		t.Errorf("Seed() did not round-trip the master key.")
+	}
+
+	message := make([]byte, 32)
+	rand.Read(message)
+
+	signature, err := signer.Sign(nil, message, SignerOpts{})
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	pub := priv.Public().(PublicKey)
+	if !Verify(message, pub.Bytes, signature, 0, pub.Params) {
+		t.Error("Signature produced via crypto.Signer does not verify.")
+	}
+
+	if !bytes.Equal(signature, Sign(message, priv.sk, 0, priv.Params)) {
+		t.Errorf("Signer.Sign diverged from the wrapped byte-slice Sign.")
+	}
+}
+
+func TestMarshalUnmarshalBinary(t *testing.T) {
+	params, _ := SetParamsPlus(32, 16, SHA2)
+	seed := make([]byte, 32)
+	rand.Read(seed)
+
+	priv := NewKeyFromSeed(seed, params)
+	pub := priv.Public().(PublicKey)
+
+	message := make([]byte, 32)
+	rand.Read(message)
+	sig := Signature{Params: params, Bytes: Sign(message, priv.sk, 0, params)}
+
+	pubDER, err := pub.MarshalBinary()
+	if err != nil {
+		t.Fatalf("PublicKey.MarshalBinary: %v", err)
+	}
+	var pub2 PublicKey
+	if err := pub2.UnmarshalBinary(pubDER); err != nil {
+		t.Fatalf("PublicKey.UnmarshalBinary: %v", err)
+	}
+	if !bytes.Equal(pub2.Bytes, pub.Bytes) || pub2.Params != pub.Params {
+		t.Errorf("PublicKey did not round-trip through MarshalBinary/UnmarshalBinary.")
+	}
+
+	privDER, err := priv.MarshalBinary()
+	if err != nil {
+		t.Fatalf("PrivateKey.MarshalBinary: %v", err)
+	}
+	priv2 := &PrivateKey{}
+	if err := priv2.UnmarshalBinary(privDER); err != nil {
+		t.Fatalf("PrivateKey.UnmarshalBinary: %v", err)
+	}
+	if !bytes.Equal(Sign(message, priv2.sk, 0, priv2.Params), sig.Bytes) {
+		t.Errorf("Restored PrivateKey produced a different signature.")
+	}
+
+	sigDER, err := sig.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Signature.MarshalBinary: %v", err)
+	}
+	var sig2 Signature
+	if err := sig2.UnmarshalBinary(sigDER); err != nil {
+		t.Fatalf("Signature.UnmarshalBinary: %v", err)
+	}
+	if !Verify(message, pub.Bytes, sig2.Bytes, 0, sig2.Params) {
+		t.Error("Signature restored via UnmarshalBinary does not verify.")
+	}
+
+	// A truncated buffer must be rejected, not silently accepted as a
+	// shorter (and thus weaker) key or signature.
+	if err := pub2.UnmarshalBinary(pubDER[:len(pubDER)-1]); err == nil {
+		t.Error("UnmarshalBinary accepted a truncated public key.")
+	}
+
+	// An unknown OID must be rejected outright.
+	badOID := append([]byte{}, pubDER...)
+	badOID[5], badOID[6] = 0xff, 0xff
+	if err := pub2.UnmarshalBinary(badOID); err == nil {
+		t.Error("UnmarshalBinary accepted an unknown parameter-set OID.")
+	}
+}
+
+// TestMarshalBinaryPreservesLegacyPRF checks that a Wotsparams'
+// LegacyPRF bit survives MarshalBinary/UnmarshalBinary: it is encoded in
+// the OID itself (a distinct value from the non-legacy parameter set, not
+// a bit grafted onto the shared one), so a previously-serialized
+// LegacyPRF key or signature keeps decoding under the construction it was
+// actually produced with, and a current one does not get silently
+// reinterpreted as legacy.
+func TestMarshalBinaryPreservesLegacyPRF(t *testing.T) {
+	params, _ := SetParamsPlus(32, 16, SHA2)
+	params.LegacyPRF = true
+	seed := make([]byte, 32)
+	rand.Read(seed)
+
+	priv := NewKeyFromSeed(seed, params)
+	pub := priv.Public().(PublicKey)
+	message := make([]byte, 32)
+	rand.Read(message)
+	sig := Signature{Params: params, Bytes: Sign(message, priv.sk, 0, params)}
+
+	pubDER, err := pub.MarshalBinary()
+	if err != nil {
+		t.Fatalf("PublicKey.MarshalBinary: %v", err)
+	}
+	var pub2 PublicKey
+	if err := pub2.UnmarshalBinary(pubDER); err != nil {
+		t.Fatalf("PublicKey.UnmarshalBinary: %v", err)
+	}
+	if !pub2.Params.LegacyPRF {
+		t.Fatal("UnmarshalBinary lost LegacyPRF on a public key round trip.")
+	}
+
+	sigDER, err := sig.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Signature.MarshalBinary: %v", err)
+	}
+	var sig2 Signature
+	if err := sig2.UnmarshalBinary(sigDER); err != nil {
+		t.Fatalf("Signature.UnmarshalBinary: %v", err)
+	}
+	if !sig2.Params.LegacyPRF {
+		t.Fatal("UnmarshalBinary lost LegacyPRF on a signature round trip.")
+	}
+	if !Verify(message, pub2.Bytes, sig2.Bytes, 0, sig2.Params) {
+		t.Error("LegacyPRF signature restored via UnmarshalBinary does not verify.")
+	}
+
+	// A non-legacy key of the same (n, w, plus, hash) must use a
+	// different OID, not the legacy one.
+	nonLegacy, _ := SetParamsPlus(32, 16, SHA2)
+	nonLegacyPriv := NewKeyFromSeed(seed, nonLegacy)
+	nonLegacyDER, err := nonLegacyPriv.Public().(PublicKey).MarshalBinary()
+	if err != nil {
+		t.Fatalf("PublicKey.MarshalBinary: %v", err)
+	}
+	if bytes.Equal(nonLegacyDER[:7], pubDER[:7]) {
+		t.Error("Legacy and non-legacy parameter sets serialized to the same OID.")
+	}
+}
+
+func TestMarshalParsePEM(t *testing.T) {
+	params, _ := SetParamsPlus(32, 16, SHA2)
+	seed := make([]byte, 32)
+	rand.Read(seed)
+
+	priv := NewKeyFromSeed(seed, params)
+	pub := priv.Public().(PublicKey)
+
+	message := make([]byte, 32)
+	rand.Read(message)
+	sig := Signature{Params: params, Bytes: Sign(message, priv.sk, 0, params)}
+
+	pubPEM, err := pub.MarshalPEM()
+	if err != nil {
+		t.Fatalf("PublicKey.MarshalPEM: %v", err)
+	}
+	pub2, err := ParsePublicKeyPEM(pubPEM)
+	if err != nil {
+		t.Fatalf("ParsePublicKeyPEM: %v", err)
+	}
+	if !bytes.Equal(pub2.Bytes, pub.Bytes) {
+		t.Errorf("PublicKey did not round-trip through PEM.")
+	}
+
+	privPEM, err := priv.MarshalPEM()
+	if err != nil {
+		t.Fatalf("PrivateKey.MarshalPEM: %v", err)
+	}
+	priv2, err := ParsePrivateKeyPEM(privPEM)
+	if err != nil {
+		t.Fatalf("ParsePrivateKeyPEM: %v", err)
+	}
+	if !bytes.Equal(Sign(message, priv2.sk, 0, priv2.Params), sig.Bytes) {
+		t.Errorf("PrivateKey restored from PEM produced a different signature.")
+	}
+
+	sigPEM, err := sig.MarshalPEM()
+	if err != nil {
+		t.Fatalf("Signature.MarshalPEM: %v", err)
+	}
+	sig2, err := ParseSignaturePEM(sigPEM)
+	if err != nil {
+		t.Fatalf("ParseSignaturePEM: %v", err)
+	}
+	if !Verify(message, pub.Bytes, sig2.Bytes, 0, sig2.Params) {
+		t.Error("Signature restored from PEM does not verify.")
+	}
+
+	if _, err := ParsePublicKeyPEM(privPEM); err == nil {
+		t.Error("ParsePublicKeyPEM accepted a WOTS PRIVATE KEY block.")
+	}
+}
+
+// TestParallelismMatchesSerial checks that KeyGen, Sign and Verify produce
+// identical bytes whether Wotsparams.Parallelism forces the serial path
+// (1) or is left at its auto default (0), so existing determinism tests
+// stay valid regardless of how many goroutines a given build fans out to.
+func TestParallelismMatchesSerial(t *testing.T) {
+	base, _ := SetParamsPlus(32, 16, SHA2)
+	serial := base
+	serial.Parallelism = 1
+	parallel := base
+	parallel.Parallelism = 0
+
+	masterkey := make([]byte, 32)
+	message := make([]byte, 32)
+	rand.Read(masterkey)
+	rand.Read(message)
+
+	sk1, pk1 := KeyGen(masterkey, serial)
+	sk2, pk2 := KeyGen(masterkey, parallel)
+	if !bytes.Equal(sk1, sk2) || !bytes.Equal(pk1, pk2) {
+		t.Fatal("KeyGen under Parallelism=0 diverged from Parallelism=1.")
+	}
+
+	sig1 := Sign(message, sk1, 0, serial)
+	sig2 := Sign(message, sk2, 0, parallel)
+	if !bytes.Equal(sig1, sig2) {
+		t.Fatal("Sign under Parallelism=0 diverged from Parallelism=1.")
+	}
+
+	if !Verify(message, pk1, sig1, 0, serial) || !Verify(message, pk2, sig2, 0, parallel) {
+		t.Error("A signature produced under one Parallelism setting failed to verify.")
+	}
+}
+
+// TestLegacyPRFMigration checks that Wotsparams.LegacyPRF selects between
+// two genuinely different private key derivations -- the default
+// ADRS-based PRF and the legacy counter-based one -- while both remain
+// internally consistent: each produces a key pair whose own signature
+// verifies, and the two constructions diverge in bytes for the same
+// master key.
+func TestLegacyPRFMigration(t *testing.T) {
+	masterkey := make([]byte, 32)
+	message := make([]byte, 32)
+	rand.Read(masterkey)
+	rand.Read(message)
+
+	current, _ := SetParamsPlus(32, 16, SHA2)
+	legacy := current
+	legacy.LegacyPRF = true
+
+	skCurrent, pkCurrent := KeyGen(masterkey, current)
+	skLegacy, pkLegacy := KeyGen(masterkey, legacy)
+
+	if bytes.Equal(skCurrent, skLegacy) || bytes.Equal(pkCurrent, pkLegacy) {
+		t.Fatal("LegacyPRF=false and LegacyPRF=true derived identical keys from the same master key.")
+	}
+
+	sigCurrent := Sign(message, skCurrent, 0, current)
+	sigLegacy := Sign(message, skLegacy, 0, legacy)
+
+	if !Verify(message, pkCurrent, sigCurrent, 0, current) {
+		t.Error("Default (non-legacy) PRF signature does not verify.")
+	}
+	if !Verify(message, pkLegacy, sigLegacy, 0, legacy) {
+		t.Error("LegacyPRF signature does not verify.")
+	}
+	if Verify(message, pkLegacy, sigCurrent, 0, current) {
+		t.Error("A default-PRF signature verified against a LegacyPRF public key.")
+	}
+}
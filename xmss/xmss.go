@@ -0,0 +1,362 @@
+/*
+Package xmss implements the XMSS many-time hash-based signature scheme
+(RFC 8391) as a Merkle tree of WOTS+ one-time key pairs.
+
+Unlike wots.Sign, which refuses to be used more than once, an xmss
+PrivateKey can sign up to 2^H messages: each call to Sign consumes the
+next leaf in index order, advances the leaf counter, and never reuses a
+leaf's WOTS+ key pair. Sign returns an authentication path alongside the
+WOTS+ signature so Verify can walk back up to the tree root without ever
+needing the secret key.
+*/
+package xmss
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+
+	"github.com/femcoder/wots"
+)
+
+// ADRS type values for the two address kinds XMSS adds on top of the OTS
+// Hash Address wots.go already builds (RFC 8391 §2.7).
+const (
+	adrsLTreeAddress    = 1
+	adrsHashTreeAddress = 2
+)
+
+// Params holds the tree height together with the WOTS+ parameters used
+// for every leaf's one-time key pair.
+type Params struct {
+	H    int
+	Wots wots.Wotsparams
+}
+
+// SetParams builds a Params for a tree of height h (2^h leaves, i.e.
+// 2^h available signatures) whose leaves are WOTS+ key pairs with
+// security parameter n and Winternitz parameter w. hash selects the hash
+// family for both the leaves' WOTS+ chains and this package's own
+// tree/L-tree hashing (f, hmsg below), which route through
+// wots.HasherFor(params.Wots) rather than a standalone hash construction,
+// so the two always agree and both benefit from whatever hardening wots
+// applies to F/H/PRF/Hmsg.
+//
+// Each leaf's own WOTS+ key pair is forced to wots.Wotsparams.Parallelism
+// = 1: a single leaf only has length (tens of) short chains, too little
+// work to be worth a goroutine fan-out, and KeyGen already builds up to
+// 2^h leaves in its own loop -- spinning up GOMAXPROCS workers per leaf
+// would pay that overhead 2^h times over for no benefit.
+func SetParams(h int, n int, w int, hash wots.HashFunc) (Params, error) {
+	if h <= 0 {
+		return Params{}, errors.New("h has to be positive")
+	}
+	wp, err := wots.SetParamsPlus(n, w, hash)
+	if err != nil {
+		return Params{}, err
+	}
+	wp.Parallelism = 1
+	return Params{H: h, Wots: wp}, nil
+}
+
+// PrivateKey is the XMSS secret key: the leaf counter idx, the seeds the
+// whole tree is deterministically derived from, and a full copy of the
+// tree built in KeyGen (every node at every level, not just an O(H)
+// traversal state) so authentication paths don't need to be recomputed
+// from scratch on every Sign. This is a full-tree cache, not the RFC's
+// memory-bounded BDS traversal algorithm: it holds O(2^H) n-byte nodes
+// rather than O(H), which is the right tradeoff for the tree heights
+// this package targets but would not scale to the much larger heights
+// (e.g. as a hypertree layer) where real BDS earns its complexity.
+type PrivateKey struct {
+	Params  Params
+	Idx     uint32
+	SKSeed  []byte
+	SKPRF   []byte
+	PubSeed []byte
+	Root    []byte
+
+	tree [][][]byte // tree[level][index]; tree[0] holds the leaves
+}
+
+// PublicKey is the XMSS public key: the tree root plus the pubSeed every
+// leaf's WOTS+ key pair and L-tree/tree-hash call was keyed with.
+type PublicKey struct {
+	Params  Params
+	Root    []byte
+	PubSeed []byte
+}
+
+// Signature is an XMSS signature: the leaf index it was produced from,
+// the randomization string r, the leaf's WOTS+ signature, and the
+// authentication path of sibling nodes from that leaf up to the root.
+type Signature struct {
+	Idx      uint32
+	R        []byte
+	OTS      []byte
+	AuthPath [][]byte
+}
+
+// KeyGen builds a tree of height params.H from a 3*n-byte seed, split
+// into SK_seed, SK_PRF and pubSeed (in that order). The seed MUST be
+// chosen uniformly at random.
+func KeyGen(seed []byte, params Params) (*PrivateKey, *PublicKey, error) {
+	n := params.Wots.N()
+	if len(seed) != 3*n {
+		return nil, nil, errors.New("xmss: seed must be 3*n bytes (SK_seed || SK_PRF || pubSeed)")
+	}
+	skSeed := append([]byte{}, seed[0:n]...)
+	skPRF := append([]byte{}, seed[n:2*n]...)
+	pubSeed := append([]byte{}, seed[2*n:3*n]...)
+
+	numLeaves := 1 << uint(params.H)
+	leaves := make([][]byte, numLeaves)
+	for idx := 0; idx < numLeaves; idx++ {
+		leaves[idx] = leaf(params, skSeed, pubSeed, uint32(idx))
+	}
+
+	tree := buildTree(leaves, pubSeed, params.Wots)
+	root := tree[len(tree)-1][0]
+
+	sk := &PrivateKey{
+		Params:  params,
+		Idx:     0,
+		SKSeed:  skSeed,
+		SKPRF:   skPRF,
+		PubSeed: pubSeed,
+		Root:    append([]byte{}, root...),
+		tree:    tree,
+	}
+	pk := &PublicKey{
+		Params:  params,
+		Root:    append([]byte{}, root...),
+		PubSeed: append([]byte{}, pubSeed...),
+	}
+	return sk, pk, nil
+}
+
+// Sign consumes the next unused leaf and produces a signature for
+// message. It returns an error once every one of the 2^H leaves has
+// already been used; callers must never retain or reconstruct a
+// PrivateKey at an Idx that was already signed with, as that reuses a
+// WOTS+ one-time key.
+func (sk *PrivateKey) Sign(message []byte) (*Signature, error) {
+	numLeaves := uint32(1) << uint(sk.Params.H)
+	if sk.Idx >= numLeaves {
+		return nil, errors.New("xmss: secret key exhausted, generate a new one")
+	}
+	idx := sk.Idx
+	h := wots.HasherFor(sk.Params.Wots)
+
+	r := h.PRF(sk.SKPRF, idxBytes(idx))
+	digest := h.Hmsg(r, sk.Root, idx, message)
+
+	otsSeed := h.PRF(sk.SKSeed, idxBytes(idx))
+	wsk, _ := wots.KeyGenSeeded(otsSeed, sk.PubSeed, idx, sk.Params.Wots)
+	otsSig := wots.Sign(digest, wsk, idx, sk.Params.Wots)
+
+	path := sk.authPath(idx)
+
+	sk.Idx++ // advance so this leaf can never be handed out again
+
+	return &Signature{Idx: idx, R: r, OTS: otsSig, AuthPath: path}, nil
+}
+
+// authPath reads the sibling node at every level on the way from leaf idx
+// to the root out of PrivateKey's full-tree cache, giving O(H) lookups
+// per signature instead of an O(2^H) tree rebuild. This is NOT the RFC's
+// BDS traversal: BDS achieves its O(H) lookups while bounding memory to
+// O(H) too, by reconstructing each level's authentication node lazily as
+// Sign advances through leaves. Caching the whole tree instead is simpler
+// and fine at the heights this package targets (and is still O(H)
+// lookups, which is the property callers observe), but does not bound
+// memory the way a real BDS traversal would, so this implementation is
+// not meant for the very large H a BDS-based deployment would use.
+func (sk *PrivateKey) authPath(idx uint32) [][]byte {
+	path := make([][]byte, sk.Params.H)
+	index := idx
+	for level := 0; level < sk.Params.H; level++ {
+		path[level] = sk.tree[level][index^1]
+		index >>= 1
+	}
+	return path
+}
+
+// Export serializes the minimal state needed to restore this key: the
+// advancing leaf counter plus the seeds the tree is deterministically
+// derived from. Callers MUST persist this after every Sign (or batch of
+// Signs) and pass it to Import on restart, so that a leaf already signed
+// with is never handed out again.
+func (sk *PrivateKey) Export() []byte {
+	n := sk.Params.Wots.N()
+	buf := make([]byte, 4+3*n)
+	binary.BigEndian.PutUint32(buf[0:4], sk.Idx)
+	copy(buf[4:], sk.SKSeed)
+	copy(buf[4+n:], sk.SKPRF)
+	copy(buf[4+2*n:], sk.PubSeed)
+	return buf
+}
+
+// Import rebuilds a PrivateKey, including its tree cache, from bytes
+// produced by Export for the given Params.
+func Import(data []byte, params Params) (*PrivateKey, error) {
+	n := params.Wots.N()
+	if len(data) != 4+3*n {
+		return nil, errors.New("xmss: invalid exported key length")
+	}
+	idx := binary.BigEndian.Uint32(data[0:4])
+	sk, _, err := KeyGen(append([]byte{}, data[4:]...), params)
+	if err != nil {
+		return nil, err
+	}
+	sk.Idx = idx
+	return sk, nil
+}
+
+// Verify returns true if sig is a valid signature for message under pk.
+func Verify(message []byte, sig *Signature, pk *PublicKey) bool {
+	if len(sig.AuthPath) != pk.Params.H {
+		return false
+	}
+
+	digest := hmsg(sig.R, pk.Root, sig.Idx, message, pk.Params.Wots)
+
+	chains := wots.PkFromSig(digest, sig.OTS, pk.PubSeed, sig.Idx, pk.Params.Wots)
+
+	var adrs wots.ADRS
+	adrs.SetType(adrsLTreeAddress)
+	adrs.SetOTSAddress(sig.Idx)
+	node := lTree(chains, pk.PubSeed, adrs, pk.Params.Wots)
+
+	index := sig.Idx
+	for level := 0; level < pk.Params.H; level++ {
+		sibling := sig.AuthPath[level]
+		if index&1 == 0 {
+			node = treeNode(node, sibling, pk.PubSeed, uint32(level), index>>1, pk.Params.Wots)
+		} else {
+			node = treeNode(sibling, node, pk.PubSeed, uint32(level), index>>1, pk.Params.Wots)
+		}
+		index >>= 1
+	}
+
+	return bytes.Equal(node, pk.Root)
+}
+
+// leaf computes the L-tree-compressed leaf for OTS key pair idx: a fresh
+// WOTS+ key pair keyed by the tree-wide pubSeed and a secret seed unique
+// to idx, compressed down to a single n-byte node.
+func leaf(params Params, skSeed, pubSeed []byte, idx uint32) []byte {
+	h := wots.HasherFor(params.Wots)
+	otsSeed := h.PRF(skSeed, idxBytes(idx))
+	_, wpk := wots.KeyGenSeeded(otsSeed, pubSeed, idx, params.Wots)
+	chains := wpk[:params.Wots.Length()*params.Wots.N()]
+
+	var adrs wots.ADRS
+	adrs.SetType(adrsLTreeAddress)
+	adrs.SetOTSAddress(idx)
+	return lTree(chains, pubSeed, adrs, params.Wots)
+}
+
+// lTree compresses the length WOTS+ chain values in pkChains down to a
+// single n-byte node by repeated pairwise hashing (RFC 8391 §4.1.4),
+// carrying the odd node at each level up unchanged when the count is odd.
+func lTree(pkChains []byte, pubSeed []byte, adrs wots.ADRS, wp wots.Wotsparams) []byte {
+	n := wp.N()
+	l := len(pkChains) / n
+	nodes := make([][]byte, l)
+	for i := 0; i < l; i++ {
+		nodes[i] = pkChains[i*n : (i+1)*n]
+	}
+
+	for height := uint32(0); l > 1; height++ {
+		adrs.SetChainAddress(height) // reused as the L-tree height word
+		for i := 0; i < l/2; i++ {
+			adrs.SetHashAddress(uint32(i)) // reused as the L-tree index word
+			nodes[i] = f(pubSeed, adrs, concat(nodes[2*i], nodes[2*i+1]), wp)
+		}
+		if l%2 == 1 {
+			nodes[l/2] = nodes[l-1]
+			l = l/2 + 1
+		} else {
+			l = l / 2
+		}
+	}
+	return nodes[0]
+}
+
+// buildTree builds the full Merkle tree over leaves, returning every
+// level from the leaves (tree[0]) up to the root (tree[len-1][0]).
+func buildTree(leaves [][]byte, pubSeed []byte, wp wots.Wotsparams) [][][]byte {
+	levels := [][][]byte{leaves}
+	cur := leaves
+	for height := uint32(0); len(cur) > 1; height++ {
+		next := make([][]byte, len(cur)/2)
+		for i := range next {
+			next[i] = treeNode(cur[2*i], cur[2*i+1], pubSeed, height, uint32(i), wp)
+		}
+		levels = append(levels, next)
+		cur = next
+	}
+	return levels
+}
+
+// treeNode combines a left and right child into their parent node
+// (RFC 8391 §4.1.6), keyed by pubSeed and an ADRS identifying the node's
+// height and index within that height.
+func treeNode(left, right, pubSeed []byte, height, index uint32, wp wots.Wotsparams) []byte {
+	var adrs wots.ADRS
+	adrs.SetType(adrsHashTreeAddress)
+	adrs.SetChainAddress(height) // reused as the tree-height word
+	adrs.SetHashAddress(index)   // reused as the tree-index word
+	return f(pubSeed, adrs, concat(left, right), wp)
+}
+
+// f is the keyed, bitmasked hash WOTS+ chains and the XMSS tree both use:
+// the key is PRF'd from pubSeed and adrs with keyAndMask=0, and m (which
+// may be n bytes for a chain step or 2n bytes for a tree/L-tree combine)
+// is XORed against as many further n-byte PRF outputs -- keyAndMask=1,
+// 2, ... -- as it takes to cover it, before being hashed under the key via
+// F, not PRF again, so the final step carries its own domain tag instead
+// of reusing the key-derivation primitive (see wots.Hasher).
+func f(pubSeed []byte, adrs wots.ADRS, m []byte, wp wots.Wotsparams) []byte {
+	h := wots.HasherFor(wp)
+	adrs.SetKeyAndMask(0)
+	key := h.PRF(pubSeed, adrs[:])
+
+	mask := make([]byte, 0, len(m))
+	for block := uint32(1); len(mask) < len(m); block++ {
+		adrs.SetKeyAndMask(block)
+		mask = append(mask, h.PRF(pubSeed, adrs[:])...)
+	}
+	mask = mask[:len(m)]
+
+	return h.F(key, xorBytes(m, mask))
+}
+
+// hmsg is the randomized message digest of RFC 8391 §5.1, delegating to
+// wots.Hasher.Hmsg so xmss shares the same domain-tagged construction
+// WOTS+ itself uses rather than a standalone duplicate.
+func hmsg(r, root []byte, idx uint32, message []byte, wp wots.Wotsparams) []byte {
+	return wots.HasherFor(wp).Hmsg(r, root, idx, message)
+}
+
+func idxBytes(idx uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, idx)
+	return b
+}
+
+func concat(a, b []byte) []byte {
+	out := make([]byte, 0, len(a)+len(b))
+	out = append(out, a...)
+	out = append(out, b...)
+	return out
+}
+
+func xorBytes(a, b []byte) []byte {
+	out := make([]byte, len(a))
+	for i := range a {
+		out[i] = a[i] ^ b[i]
+	}
+	return out
+}
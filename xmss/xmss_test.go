@@ -0,0 +1,135 @@
+package xmss
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/femcoder/wots"
+)
+
+func TestSetParams(t *testing.T) {
+	if _, err := SetParams(0, 32, 16, wots.SHA2); err == nil {
+		t.Errorf("Invalid height allowed.")
+	}
+
+	params, err := SetParams(4, 32, 16, wots.SHA2)
+	if err != nil {
+		t.Fatalf("SetParams: %v", err)
+	}
+	if params.H != 4 {
+		t.Errorf("H not set correctly.")
+	}
+}
+
+func TestKeyGenSignVerify(t *testing.T) {
+	params, _ := SetParams(4, 32, 16, wots.SHA2)
+	seed := make([]byte, 3*params.Wots.N())
+	rand.Read(seed)
+
+	sk, pk, err := KeyGen(seed, params)
+	if err != nil {
+		t.Fatalf("KeyGen: %v", err)
+	}
+
+	message1 := make([]byte, 32)
+	rand.Read(message1)
+
+	sig1, err := sk.Sign(message1)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if sig1.Idx != 0 {
+		t.Errorf("First signature should use leaf 0, got %d.", sig1.Idx)
+	}
+	if !Verify(message1, sig1, pk) {
+		t.Error("Signature not valid.")
+	}
+
+	message2 := make([]byte, 32)
+	rand.Read(message2)
+	sig2, err := sk.Sign(message2)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if sig2.Idx != 1 {
+		t.Errorf("Second signature should use leaf 1, got %d.", sig2.Idx)
+	}
+	if !Verify(message2, sig2, pk) {
+		t.Error("Second signature not valid.")
+	}
+
+	if Verify(message1, sig2, pk) {
+		t.Error("Signature verified for the wrong message.")
+	}
+
+	tamperedSig := *sig1
+	tamperedSig.Idx = sig2.Idx
+	if Verify(message1, &tamperedSig, pk) {
+		t.Error("Signature verified after swapping in another leaf's index.")
+	}
+}
+
+func TestKeyExhaustion(t *testing.T) {
+	params, _ := SetParams(2, 32, 16, wots.SHA2)
+	seed := make([]byte, 3*params.Wots.N())
+	rand.Read(seed)
+
+	sk, _, err := KeyGen(seed, params)
+	if err != nil {
+		t.Fatalf("KeyGen: %v", err)
+	}
+
+	message := make([]byte, 32)
+	rand.Read(message)
+
+	for i := 0; i < 4; i++ {
+		if _, err := sk.Sign(message); err != nil {
+			t.Fatalf("Sign %d: %v", i, err)
+		}
+	}
+
+	if _, err := sk.Sign(message); err == nil {
+		t.Error("Signing past 2^H leaves should fail.")
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	params, _ := SetParams(3, 32, 16, wots.SHA2)
+	seed := make([]byte, 3*params.Wots.N())
+	rand.Read(seed)
+
+	sk, pk, err := KeyGen(seed, params)
+	if err != nil {
+		t.Fatalf("KeyGen: %v", err)
+	}
+
+	message := make([]byte, 32)
+	rand.Read(message)
+
+	if _, err := sk.Sign(message); err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	restored, err := Import(sk.Export(), params)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if restored.Idx != sk.Idx {
+		t.Errorf("Restored Idx = %d, want %d.", restored.Idx, sk.Idx)
+	}
+	if !bytes.Equal(restored.Root, pk.Root) {
+		t.Errorf("Restored key rebuilt a different tree.")
+	}
+
+	sig, err := restored.Sign(message)
+	if err != nil {
+		t.Fatalf("Sign after restore: %v", err)
+	}
+	if sig.Idx != sk.Idx {
+		t.Errorf("Signature after restore reused leaf %d.", sig.Idx)
+	}
+	if !Verify(message, sig, pk) {
+		t.Error("Signature produced after restore does not verify.")
+	}
+}